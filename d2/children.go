@@ -0,0 +1,63 @@
+// Copyright 2021 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package d2
+
+import "github.com/tidwall/geoindex/child"
+
+// childNode and Children are specific to the 2D package: they exist to
+// integrate with github.com/tidwall/geoindex, whose child.Child type is
+// itself hardcoded to [2]float64 rectangles, so this isn't something the
+// generated, dimension-generic code in ptree.go can express for d1/d3/d4.
+type childNode[T any] struct {
+	min, max [2]float64
+	node     *node[T]
+}
+
+// Children returns all children for parent node. If parent node is nil
+// then the root nodes should be returned.
+// The reuse buffer is an empty length slice that can optionally be used
+// to avoid extra allocations.
+func (tr *PTree[T]) Children(parent interface{}, reuse []child.Child,
+) (children []child.Child) {
+	children = reuse[:0]
+	if parent == nil {
+		children = append(children, child.Child{
+			Min: tr.min, Max: tr.max,
+			Data: childNode[T]{tr.min, tr.max, tr.root},
+			Item: false,
+		})
+		return children
+	}
+	cnode := parent.(childNode[T])
+	nmin, nmax := cnode.min, cnode.max
+	n := cnode.node
+	if n.nodes == nil {
+		// scan over child items
+		for _, it := range n.items {
+			children = append(children, child.Child{
+				Min: it.point, Max: it.point,
+				Data: it.data, Item: true,
+			})
+		}
+		return children
+	}
+	// scan over all child nodes
+	var lo, hi [2]int
+	hi[0], hi[1] = rows-1, rows-1
+	eachCell(lo, hi, func(coords [2]int) bool {
+		cidx, cmin, cmax := getChildNodeIndex(nmin, nmax, coords)
+		cn := n.nodes[cidx]
+		if cn == nil || cn.count == 0 {
+			return true
+		}
+		children = append(children, child.Child{
+			Min: cmin, Max: cmax,
+			Data: childNode[T]{cmin, cmax, cn},
+			Item: false,
+		})
+		return true
+	})
+	return children
+}
@@ -0,0 +1,112 @@
+// Copyright 2021 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package d3
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+func init() {
+	seed := time.Now().UnixNano()
+	println("seed:", seed)
+	rand.Seed(seed)
+}
+
+func randPoints(N int, min, max [3]float64) [][3]float64 {
+	var points [][3]float64
+	for i := 0; i < N; i++ {
+		var p [3]float64
+		for j := 0; j < 3; j++ {
+			p[j] = min[j] + rand.Float64()*(max[j]-min[j])
+		}
+		points = append(points, p)
+	}
+	return points
+}
+
+func boundsForPoints(points [][3]float64) (min, max [3]float64) {
+	if len(points) > 0 {
+		min, max = points[0], points[0]
+		for _, p := range points[1:] {
+			min, max = expand(min, max, p, p)
+		}
+	}
+	return min, max
+}
+
+func TestPTree(t *testing.T) {
+	N := 10_000
+	min, max := [3]float64{-180, -90, -1000}, [3]float64{180, 90, 1000}
+	points := randPoints(N, min, max)
+	tr := New[int](min, max)
+
+	for i := 0; i < len(points); i++ {
+		tr.Insert(points[i], i)
+		if tr.Len() != i+1 {
+			t.Fatalf("expected %d, got %d", i+1, tr.Len())
+		}
+	}
+
+	bmin, bmax := boundsForPoints(points)
+	tmin, tmax := tr.MinBounds()
+	if tmin != bmin || tmax != bmax {
+		t.Fatalf("expected '%v,%v', got '%v,%v'", bmin, bmax, tmin, tmax)
+	}
+
+	for i := 0; i < len(points); i += 97 {
+		testSearch(t, tr, points, 0)
+	}
+
+	for i := 0; i < len(points); i++ {
+		tr.Delete(points[i], i)
+		if tr.Len() != len(points)-i-1 {
+			t.Fatalf("expected %d, got %d", len(points)-i-1, tr.Len())
+		}
+	}
+}
+
+func testSearch(t *testing.T, tr *PTree[int], points [][3]float64, sidx int) {
+	var min, max [3]float64
+	for i := 0; i < 3; i++ {
+		a := rand.Float64()*400 - 200
+		b := rand.Float64()*400 - 200
+		if a > b {
+			a, b = b, a
+		}
+		min[i], max[i] = a, b
+	}
+
+	type result struct {
+		point [3]float64
+		data  int
+	}
+	var res1, res2 []result
+	tr.Search(min, max, func(point [3]float64, data int) bool {
+		res1 = append(res1, result{point, data})
+		return true
+	})
+	for i := 0; i < len(points); i++ {
+		if contains(min, max, points[i]) {
+			res2 = append(res2, result{points[i], i + sidx})
+		}
+	}
+	sort.Slice(res1, func(i, j int) bool {
+		return res1[i].data < res1[j].data
+	})
+	sort.Slice(res2, func(i, j int) bool {
+		return res2[i].data < res2[j].data
+	})
+	if len(res1) != len(res2) {
+		t.Fatal("mismatch")
+	}
+	for i := 0; i < len(res1); i++ {
+		if res1[i] != res2[i] {
+			t.Fatal("mismatch")
+		}
+	}
+}
@@ -2,64 +2,120 @@
 // Use of this source code is governed by an MIT-style
 // license that can be found in the LICENSE file.
 
+// Package ptree implements a tree for storing and searching points.
+//
+// The core algorithm is dimension-generic: internal/gen/ptree_base.go.tmpl
+// is expanded by gen.sh into the d1, d2, d3, and d4 subpackages, one
+// fully-typed PTree per supported dimension count. PTree here wraps
+// d2.PTree, so existing 2D callers are unaffected; Open dispatches to
+// whichever of those packages matches the dimensionality of the bounds
+// it's given.
 package ptree
 
+//go:generate ./gen.sh
+
 import (
-	"math"
+	"fmt"
 
-	"github.com/tidwall/geoindex/child"
+	"github.com/tidwall/ptree/d1"
+	"github.com/tidwall/ptree/d2"
+	"github.com/tidwall/ptree/d3"
+	"github.com/tidwall/ptree/d4"
 )
 
-const maxEntries = 256                   // max number of entries per node
-const minEntries = maxEntries * 40 / 100 // min number of entries per node
+// PTree is a tree for storing points, each carrying a payload of type T.
+// It embeds d2.PTree, so a *PTree[T] has the full 2D API (Insert, Search,
+// KNN, and so on) without the facade needing to re-declare each method;
+// Snapshot is the one exception, redeclared below so it returns a *PTree
+// rather than the embedded *d2.PTree. (A plain type alias, as used for
+// the pre-generics PTree, can't itself take a type parameter, so a thin
+// wrapper takes its place.)
+type PTree[T any] struct {
+	*d2.PTree[T]
+}
 
-const maxHeight = 16 // a limit is needed to avoid infinite splits
-const rows = 16      // 16 = 256 child nodes, 8 = 64, 4 = 16, 2 = 4
+// PTreeAny is a PTree whose payload is untyped, matching the pre-generics
+// API. It exists so code that needs to hand a PTree to something
+// expecting interface{} data (such as the geoindex.Interface wrapper in
+// ptree_test.go) doesn't need to be generic itself.
+type PTreeAny = PTree[any]
 
-type item struct {
-	point [2]float64
-	data  interface{}
+// New returns a new PTree with the provided maximum bounding rectangle.
+func New[T any](min, max [2]float64) *PTree[T] {
+	return &PTree[T]{d2.New[T](min, max)}
 }
 
-type node struct {
-	nodes *[rows * rows]*node
-	count int
-	items []item
+// Load builds a new PTree in a single pass from points and their data
+// (which must be the same length), rather than calling Insert once per
+// point. See d2.Load for details.
+func Load[T any](min, max [2]float64, points [][2]float64, data []T) *PTree[T] {
+	return &PTree[T]{d2.Load(min, max, points, data)}
 }
 
-// PTree is a tree for storing points.
-type PTree struct {
-	min  [2]float64
-	max  [2]float64
-	root node
+// LoadFunc is like Load, but pulls the n points through an iterator
+// instead of requiring them already collected into slices.
+func LoadFunc[T any](min, max [2]float64, n int,
+	iter func(i int) (point [2]float64, data T),
+) *PTree[T] {
+	return &PTree[T]{d2.LoadFunc(min, max, n, iter)}
 }
 
-// New returns a new PTree with the provided maximum bounding rectangle.
-func New(min, max [2]float64) *PTree {
-	return &PTree{min: min, max: max}
+// Snapshot returns a new *PTree that shares structure with tr. See
+// d2.PTree.Snapshot for details.
+func (tr *PTree[T]) Snapshot() *PTree[T] {
+	return &PTree[T]{tr.PTree.Snapshot()}
 }
 
-// InBounds return true if the point can be contained in the tree's maximum
-// bounding rectangle.
-func (tr *PTree) InBounds(point [2]float64) bool {
-	return contains(tr.min, tr.max, point)
+// Interface is the dimension-agnostic subset of the PTree API, with
+// points passed as slices instead of fixed-size arrays. It's implemented
+// by the value returned from Open.
+type Interface interface {
+	InBounds(point []float64) bool
+	Insert(point []float64, data interface{})
+	Delete(point []float64, data interface{})
+	Search(min, max []float64, iter func(point []float64, data interface{}) bool)
+	Scan(iter func(point []float64, data interface{}) bool)
+	Len() int
+	MinBounds() (min, max []float64)
 }
 
-// Insert a point into the tree.
-func (tr *PTree) Insert(point [2]float64, data interface{}) {
-	if !tr.InBounds(point) {
-		panic("point out of bounds")
+// Open returns a new tree over points of len(min) dimensions, wrapped
+// behind Interface and backed by whichever of the d1..d4 packages
+// matches. min and max must be the same length, and currently only 1 to 4
+// dimensions are supported.
+func Open(min, max []float64) (Interface, error) {
+	if len(min) != len(max) {
+		return nil, fmt.Errorf("ptree: min and max have different dimensions")
+	}
+	switch len(min) {
+	case 1:
+		return newD1(min, max), nil
+	case 2:
+		return newD2(min, max), nil
+	case 3:
+		return newD3(min, max), nil
+	case 4:
+		return newD4(min, max), nil
+	default:
+		return nil, fmt.Errorf("ptree: unsupported number of dimensions: %d",
+			len(min))
 	}
-	tr.root.insert(tr.min, tr.max, point, data, 1)
 }
 
-func (n *node) split(nmin, nmax [2]float64, depth int) {
-	n.nodes = new([rows * rows]*node)
-	n.count = 0
-	for _, item := range n.items {
-		n.insert(nmin, nmax, item.point, item.data, depth)
+func expand(amin, amax, bmin, bmax [2]float64) (min, max [2]float64) {
+	if bmin[0] < amin[0] {
+		amin[0] = bmin[0]
+	}
+	if bmax[0] > amax[0] {
+		amax[0] = bmax[0]
 	}
-	n.items = nil
+	if bmin[1] < amin[1] {
+		amin[1] = bmin[1]
+	}
+	if bmax[1] > amax[1] {
+		amax[1] = bmax[1]
+	}
+	return amin, amax
 }
 
 func contains(min, max, pt [2]float64) bool {
@@ -67,343 +123,142 @@ func contains(min, max, pt [2]float64) bool {
 		pt[1] < min[1] || pt[1] > max[1])
 }
 
-// bottom-up z-order
-func calcNodeIndex(x, y int) int {
-	return y*rows + x
-}
+type wrapD1 struct{ tr *d1.PTree[interface{}] }
 
-func fmin(a, b float64) float64 {
-	if a < b {
-		return a
-	}
-	return b
+func newD1(min, max []float64) Interface {
+	return &wrapD1{d1.New[interface{}]([1]float64{min[0]}, [1]float64{max[0]})}
 }
-
-func fmax(a, b float64) float64 {
-	if a > b {
-		return a
-	}
-	return b
+func (w *wrapD1) InBounds(point []float64) bool {
+	return w.tr.InBounds([1]float64{point[0]})
 }
-
-func (n *node) insert(nmin, nmax, point [2]float64, data interface{}, depth int,
+func (w *wrapD1) Insert(point []float64, data interface{}) {
+	w.tr.Insert([1]float64{point[0]}, data)
+}
+func (w *wrapD1) Delete(point []float64, data interface{}) {
+	w.tr.Delete([1]float64{point[0]}, data)
+}
+func (w *wrapD1) Search(min, max []float64,
+	iter func(point []float64, data interface{}) bool,
 ) {
-	if n.nodes == nil {
-		if len(n.items) < maxEntries || depth > maxHeight {
-			n.items = append(n.items, item{point: point, data: data})
-			n.count++
-			return
-		}
-		n.split(nmin, nmax, depth)
-	}
-
-	// choose the coordinates of the child node to insert into
-	cx := int((point[0] - nmin[0]) / (nmax[0] - nmin[0]) * rows) // node x index
-	cy := int((point[1] - nmin[1]) / (nmax[1] - nmin[1]) * rows) // node y index
+	w.tr.Search([1]float64{min[0]}, [1]float64{max[0]},
+		func(point [1]float64, data interface{}) bool {
+			return iter(point[:], data)
+		})
+}
+func (w *wrapD1) Scan(iter func(point []float64, data interface{}) bool) {
+	w.tr.Scan(func(point [1]float64, data interface{}) bool {
+		return iter(point[:], data)
+	})
+}
+func (w *wrapD1) Len() int { return w.tr.Len() }
+func (w *wrapD1) MinBounds() (min, max []float64) {
+	mn, mx := w.tr.MinBounds()
+	return mn[:], mx[:]
+}
 
-	cidx, cmin, cmax := n.getChildNodeIndex(nmin, nmax, cx, cy)
+type wrapD2 struct{ tr *d2.PTree[interface{}] }
 
-	// insert into the node
-	if n.nodes[cidx] == nil {
-		n.nodes[cidx] = new(node)
-	}
-	n.nodes[cidx].insert(cmin, cmax, point, data, depth+1)
-	n.count++
+func newD2(min, max []float64) Interface {
+	return &wrapD2{d2.New[interface{}]([2]float64{min[0], min[1]}, [2]float64{max[0], max[1]})}
 }
-
-// Search for points in the tree that are within the provided rectangle.
-func (tr *PTree) Search(min, max [2]float64,
-	iter func(point [2]float64, data interface{}) bool,
+func (w *wrapD2) InBounds(point []float64) bool {
+	return w.tr.InBounds([2]float64{point[0], point[1]})
+}
+func (w *wrapD2) Insert(point []float64, data interface{}) {
+	w.tr.Insert([2]float64{point[0], point[1]}, data)
+}
+func (w *wrapD2) Delete(point []float64, data interface{}) {
+	w.tr.Delete([2]float64{point[0], point[1]}, data)
+}
+func (w *wrapD2) Search(min, max []float64,
+	iter func(point []float64, data interface{}) bool,
 ) {
-	tr.root.search(tr.min, tr.max, min, max, iter)
+	w.tr.Search([2]float64{min[0], min[1]}, [2]float64{max[0], max[1]},
+		func(point [2]float64, data interface{}) bool {
+			return iter(point[:], data)
+		})
 }
-
-func (n *node) search(
-	nmin, nmax [2]float64, // node rectangle
-	smin, smax [2]float64, // search rectangle
-	iter func(point [2]float64, data interface{}) bool,
-) bool {
-	if n.nodes == nil {
-		for _, item := range n.items {
-			if contains(smin, smax, item.point) {
-				if !iter(item.point, item.data) {
-					return false
-				}
-			}
-		}
-		return true
-	}
-
-	// clip the search rectangle
-	smin[0] = fmax(smin[0], nmin[0])
-	smin[1] = fmax(smin[1], nmin[1])
-	smax[0] = fmin(smax[0], nmax[0])
-	smax[1] = fmin(smax[1], nmax[1])
-
-	// choose the coordinates of the child node to search
-	cx1 := int((smin[0] - nmin[0]) / (nmax[0] - nmin[0]) * rows) // x min index
-	cy1 := int((smin[1] - nmin[1]) / (nmax[1] - nmin[1]) * rows) // y min index
-	cx2 := int((smax[0] - nmin[0]) / (nmax[0] - nmin[0]) * rows) // x max index
-	cy2 := int((smax[1] - nmin[1]) / (nmax[1] - nmin[1]) * rows) // y max index
-
-	// clip the max boundaries of the coordinates
-	if cx2 >= rows {
-		cx2 = rows - 1
-	}
-	if cy2 >= rows {
-		cy2 = rows - 1
-	}
-
-	// scan over all child nodes within the coordinates range
-	for cy := cy1; cy <= cy2; cy++ {
-		for cx := cx1; cx <= cx2; cx++ {
-			cidx, cmin, cmax := n.getChildNodeIndex(nmin, nmax, cx, cy)
-			cn := n.nodes[cidx]
-			if cn != nil {
-				if !cn.search(cmin, cmax, smin, smax, iter) {
-					return false
-				}
-			}
-		}
-	}
-	return true
+func (w *wrapD2) Scan(iter func(point []float64, data interface{}) bool) {
+	w.tr.Scan(func(point [2]float64, data interface{}) bool {
+		return iter(point[:], data)
+	})
 }
-
-// Delete a point for the tree
-func (tr *PTree) Delete(point [2]float64, data interface{}) {
-	tr.root.delete(tr.min, tr.max, point, data)
+func (w *wrapD2) Len() int { return w.tr.Len() }
+func (w *wrapD2) MinBounds() (min, max []float64) {
+	mn, mx := w.tr.MinBounds()
+	return mn[:], mx[:]
 }
 
-func (n *node) delete(nmin, nmax, point [2]float64, data interface{}) bool {
-	if n.nodes == nil {
-		for i := 0; i < len(n.items); i++ {
-			if n.items[i].point == point && n.items[i].data == data {
-				n.items[i] = n.items[len(n.items)-1]
-				n.items[len(n.items)-1].data = nil
-				n.items = n.items[:len(n.items)-1]
-				n.count--
-				return true
-			}
-		}
-		return false
-	}
-
-	// choose the coordinates of the child node to delete from
-	cx := int((point[0] - nmin[0]) / (nmax[0] - nmin[0]) * rows) // node x index
-	cy := int((point[1] - nmin[1]) / (nmax[1] - nmin[1]) * rows) // node y index
+type wrapD3 struct{ tr *d3.PTree[interface{}] }
 
-	cidx, cmin, cmax := n.getChildNodeIndex(nmin, nmax, cx, cy)
-
-	cn := n.nodes[cidx]
-	if cn != nil {
-		// delete from the node
-		if !cn.delete(cmin, cmax, point, data) {
-			return false
-		}
-		if cn.count == 0 {
-			n.nodes[cidx] = nil
-		}
-	}
-	n.count--
-	if n.count < minEntries {
-		// compact the node
-		var items []item
-		n.items = n.gather(items)
-		n.nodes = nil
-	}
-	return true
+func newD3(min, max []float64) Interface {
+	return &wrapD3{d3.New[interface{}](
+		[3]float64{min[0], min[1], min[2]},
+		[3]float64{max[0], max[1], max[2]})}
 }
-
-func (n *node) gather(items []item) []item {
-	items = append(items, n.items...)
-	if n.nodes != nil {
-		for i := 0; i < rows*rows; i++ {
-			if n.nodes[i] != nil {
-				items = n.nodes[i].gather(items)
-			}
-		}
-	}
-	return items
+func (w *wrapD3) InBounds(point []float64) bool {
+	return w.tr.InBounds([3]float64{point[0], point[1], point[2]})
 }
-
-// Len returns the number of points in the tree
-func (tr *PTree) Len() int {
-	return tr.root.count
+func (w *wrapD3) Insert(point []float64, data interface{}) {
+	w.tr.Insert([3]float64{point[0], point[1], point[2]}, data)
 }
-
-// Scan all items in tree
-func (tr *PTree) Scan(iter func(point [2]float64, data interface{}) bool) {
-	tr.root.scan(iter)
+func (w *wrapD3) Delete(point []float64, data interface{}) {
+	w.tr.Delete([3]float64{point[0], point[1], point[2]}, data)
 }
-
-func (n *node) scan(iter func(point [2]float64, data interface{}) bool) bool {
-	if n.nodes == nil {
-		for i := 0; i < len(n.items); i++ {
-			if !iter(n.items[i].point, n.items[i].data) {
-				return false
-			}
-		}
-	} else {
-		for i := 0; i < len(n.nodes); i++ {
-			if n.nodes[i].count > 0 {
-				if !n.nodes[i].scan(iter) {
-					return false
-				}
-			}
-		}
-	}
-	return true
+func (w *wrapD3) Search(min, max []float64,
+	iter func(point []float64, data interface{}) bool,
+) {
+	w.tr.Search(
+		[3]float64{min[0], min[1], min[2]},
+		[3]float64{max[0], max[1], max[2]},
+		func(point [3]float64, data interface{}) bool {
+			return iter(point[:], data)
+		})
 }
-
-func expand(amin, amax, bmin, bmax [2]float64) (min, max [2]float64) {
-	if bmin[0] < amin[0] {
-		amin[0] = bmin[0]
-	}
-	if bmax[0] > amax[0] {
-		amax[0] = bmax[0]
-	}
-	if bmin[1] < amin[1] {
-		amin[1] = bmin[1]
-	}
-	if bmax[1] > amax[1] {
-		amax[1] = bmax[1]
-	}
-	return amin, amax
+func (w *wrapD3) Scan(iter func(point []float64, data interface{}) bool) {
+	w.tr.Scan(func(point [3]float64, data interface{}) bool {
+		return iter(point[:], data)
+	})
 }
-
-// MinBounds returns the minumum bounding rectangle of the tree.
-func (tr *PTree) MinBounds() (min, max [2]float64) {
-	if tr.Len() == 0 {
-		return
-	}
-	min[0] = tr.root.minValue(0, math.Inf(+1))
-	min[1] = tr.root.minValue(1, math.Inf(+1))
-	max[0] = tr.root.maxValue(0, math.Inf(-1))
-	max[1] = tr.root.maxValue(1, math.Inf(-1))
-	return min, max
+func (w *wrapD3) Len() int { return w.tr.Len() }
+func (w *wrapD3) MinBounds() (min, max []float64) {
+	mn, mx := w.tr.MinBounds()
+	return mn[:], mx[:]
 }
 
-func (n *node) minValue(coord int, value float64) float64 {
-	if n.nodes == nil {
-		for _, item := range n.items {
-			if item.point[coord] < value {
-				value = item.point[coord]
-			}
-		}
-	} else {
-		for ci := 0; ci < rows; ci++ {
-			for cj := 0; cj < rows; cj++ {
-				cx, cy := ci, cj
-				if coord == 1 {
-					cx, cy = cy, cx
-				}
-				cn := n.nodes[calcNodeIndex(cx, cy)]
-				if cn != nil {
-					value = cn.minValue(coord, value)
-				}
-			}
-			if !math.IsInf(value, 0) {
-				break
-			}
-		}
-	}
-	return value
-}
+type wrapD4 struct{ tr *d4.PTree[interface{}] }
 
-func (n *node) maxValue(coord int, value float64) float64 {
-	if n.nodes == nil {
-		for _, item := range n.items {
-			if item.point[coord] > value {
-				value = item.point[coord]
-			}
-		}
-	} else {
-		for ci := rows - 1; ci >= 0; ci-- {
-			for cj := rows - 1; cj >= 0; cj-- {
-				cx, cy := ci, cj
-				if coord == 1 {
-					cx, cy = cy, cx
-				}
-				cn := n.nodes[calcNodeIndex(cx, cy)]
-				if cn != nil {
-					value = cn.maxValue(coord, value)
-				}
-			}
-			if !math.IsInf(value, 0) {
-				break
-			}
-		}
-	}
-	return value
+func newD4(min, max []float64) Interface {
+	return &wrapD4{d4.New[interface{}](
+		[4]float64{min[0], min[1], min[2], min[3]},
+		[4]float64{max[0], max[1], max[2], max[3]})}
 }
-
-type childNode struct {
-	min, max [2]float64
-	node     *node
+func (w *wrapD4) InBounds(point []float64) bool {
+	return w.tr.InBounds([4]float64{point[0], point[1], point[2], point[3]})
 }
-
-// Children returns all children for parent node. If parent node is nil
-// then the root nodes should be returned.
-// The reuse buffer is an empty length slice that can optionally be used
-// to avoid extra allocations.
-func (tr *PTree) Children(parent interface{}, reuse []child.Child,
-) (children []child.Child) {
-	children = reuse[:0]
-	var nmin, nmax [2]float64
-	var n *node
-	if parent == nil {
-		children = append(children, child.Child{
-			Min: tr.min, Max: tr.max,
-			Data: childNode{tr.min, tr.max, &tr.root},
-			Item: false,
+func (w *wrapD4) Insert(point []float64, data interface{}) {
+	w.tr.Insert([4]float64{point[0], point[1], point[2], point[3]}, data)
+}
+func (w *wrapD4) Delete(point []float64, data interface{}) {
+	w.tr.Delete([4]float64{point[0], point[1], point[2], point[3]}, data)
+}
+func (w *wrapD4) Search(min, max []float64,
+	iter func(point []float64, data interface{}) bool,
+) {
+	w.tr.Search(
+		[4]float64{min[0], min[1], min[2], min[3]},
+		[4]float64{max[0], max[1], max[2], max[3]},
+		func(point [4]float64, data interface{}) bool {
+			return iter(point[:], data)
 		})
-		return children
-	}
-	cnode := parent.(childNode)
-	nmin, nmax = cnode.min, cnode.max
-	n = cnode.node
-	if n.nodes == nil {
-		// scan over child items
-		for _, item := range n.items {
-			children = append(children, child.Child{
-				Min: item.point, Max: item.point,
-				Data: item.data, Item: true,
-			})
-		}
-	} else {
-		// scan over all child nodes
-		for cy := 0; cy < rows; cy++ {
-			for cx := 0; cx < rows; cx++ {
-				cidx, cmin, cmax := n.getChildNodeIndex(nmin, nmax, cx, cy)
-				cn := n.nodes[cidx]
-				if cn == nil || cn.count == 0 {
-					continue
-				}
-				children = append(children, child.Child{
-					Min: cmin, Max: cmax,
-					Data: childNode{cmin, cmax, cn},
-					Item: false,
-				})
-			}
-		}
-	}
-	return children
 }
-
-// getChildNodeIndex returns the child node rect and index from the row x/y
-// coordinates.
-func (n *node) getChildNodeIndex(nmin, nmax [2]float64, cx, cy int,
-) (cidx int, cmin, cmax [2]float64) {
-	cnw := (nmax[0] - nmin[0]) / rows // width of each node
-	cnh := (nmax[1] - nmin[1]) / rows // height of each node
-	cmin = [2]float64{
-		cnw*float64(cx) + nmin[0], // node min x
-		cnh*float64(cy) + nmin[1], // node max x
-	}
-	cmax = [2]float64{
-		cmin[0] + cnw, // node min y
-		cmin[1] + cnh, // node max y
-	}
-	cidx = calcNodeIndex(cx, cy)
-	return
+func (w *wrapD4) Scan(iter func(point []float64, data interface{}) bool) {
+	w.tr.Scan(func(point [4]float64, data interface{}) bool {
+		return iter(point[:], data)
+	})
+}
+func (w *wrapD4) Len() int { return w.tr.Len() }
+func (w *wrapD4) MinBounds() (min, max []float64) {
+	mn, mx := w.tr.MinBounds()
+	return mn[:], mx[:]
 }
@@ -53,7 +53,7 @@ func boundsForPoints(points [][2]float64) (min, max [2]float64) {
 func TestPTree(t *testing.T) {
 	N := 10_000
 	points := randPoints(N, [2]float64{-180, -90}, [2]float64{180, 90})
-	tr := New([2]float64{-180, -90}, [2]float64{180, 90})
+	tr := New[int]([2]float64{-180, -90}, [2]float64{180, 90})
 	var bmin, bmax [2]float64
 
 	var testChildren = func(nPoints int) {
@@ -95,8 +95,8 @@ func TestPTree(t *testing.T) {
 		}
 		var count int
 		tr.Search(points[i], points[i],
-			func(point [2]float64, data interface{}) bool {
-				if point == points[i] && data.(int) == i {
+			func(point [2]float64, data int) bool {
+				if point == points[i] && data == i {
 					count++
 				}
 				return true
@@ -113,9 +113,8 @@ func TestPTree(t *testing.T) {
 
 	// scan test
 	var count int
-	tr.Scan(func(point [2]float64, data interface{}) bool {
-		i := data.(int)
-		if point == points[i] && data.(int) == i {
+	tr.Scan(func(point [2]float64, data int) bool {
+		if point == points[data] {
 			count++
 		}
 		return true
@@ -149,8 +148,8 @@ func TestPTree(t *testing.T) {
 		}
 		var count int
 		tr.Search(points[i], points[i],
-			func(point [2]float64, data interface{}) bool {
-				if point == points[i] && data.(int) == i {
+			func(point [2]float64, data int) bool {
+				if point == points[i] && data == i {
 					count++
 				}
 				return true
@@ -168,7 +167,7 @@ func TestPTree(t *testing.T) {
 
 }
 
-type trwrap struct{ tr *PTree }
+type trwrap struct{ tr *PTreeAny }
 
 var _ geoindex.Interface = &trwrap{}
 
@@ -209,24 +208,24 @@ func (tr *trwrap) Scan(iter func(min, max [2]float64, data interface{}) bool) {
 	})
 
 }
-func (tr *trwrap) Len() int                      { return tr.Len() }
-func (tr *trwrap) Bounds() (min, max [2]float64) { return tr.Bounds() }
+func (tr *trwrap) Len() int                      { return tr.tr.Len() }
+func (tr *trwrap) Bounds() (min, max [2]float64) { return tr.tr.MinBounds() }
 func (tr *trwrap) Children(parent interface{}, reuse []child.Child,
 ) (children []child.Child) {
 	return tr.tr.Children(parent, reuse)
 }
 
 func TestCitiesSVG(t *testing.T) {
-	tr := New([2]float64{-180, -90}, [2]float64{180, 90})
+	tr := New[interface{}]([2]float64{-180, -90}, [2]float64{180, 90})
 	geoindex.Tests.TestCitiesSVG(t, &trwrap{tr})
 }
 
 type searchResult struct {
 	point [2]float64
-	data  interface{}
+	data  int
 }
 
-func testSearch(t *testing.T, tr *PTree, points [][2]float64, sidx int) {
+func testSearch(t *testing.T, tr *PTree[int], points [][2]float64, sidx int) {
 	min := [2]float64{
 		rand.Float64()*400 - 200,
 		rand.Float64()*200 - 100,
@@ -242,7 +241,7 @@ func testSearch(t *testing.T, tr *PTree, points [][2]float64, sidx int) {
 		min[1], max[1] = max[1], min[1]
 	}
 	var res1 []searchResult
-	tr.Search(min, max, func(point [2]float64, data interface{}) bool {
+	tr.Search(min, max, func(point [2]float64, data int) bool {
 		res1 = append(res1, searchResult{point, data})
 		return true
 	})
@@ -254,10 +253,10 @@ func testSearch(t *testing.T, tr *PTree, points [][2]float64, sidx int) {
 		}
 	}
 	sort.Slice(res1, func(i, j int) bool {
-		return res1[i].data.(int) < res1[j].data.(int)
+		return res1[i].data < res1[j].data
 	})
 	sort.Slice(res2, func(i, j int) bool {
-		return res2[i].data.(int) < res2[j].data.(int)
+		return res2[i].data < res2[j].data
 	})
 
 	if len(res1) != len(res2) {
@@ -271,10 +270,327 @@ func testSearch(t *testing.T, tr *PTree, points [][2]float64, sidx int) {
 
 }
 
+func TestKNN(t *testing.T) {
+	N := 10_000
+	min, max := [2]float64{-180, -90}, [2]float64{180, 90}
+	points := randPoints(N, min, max)
+	tr := New[int](min, max)
+	for i, p := range points {
+		tr.Insert(p, i)
+	}
+
+	dist := func(a, b [2]float64) float64 {
+		dx, dy := a[0]-b[0], a[1]-b[1]
+		return math.Sqrt(dx*dx + dy*dy)
+	}
+
+	for i := 0; i < 20; i++ {
+		q := [2]float64{
+			rand.Float64()*360 - 180,
+			rand.Float64()*180 - 90,
+		}
+
+		// brute-force nearest-to-farthest ordering
+		order := make([]int, N)
+		for i := range order {
+			order[i] = i
+		}
+		sort.Slice(order, func(i, j int) bool {
+			return dist(q, points[order[i]]) < dist(q, points[order[j]])
+		})
+
+		var got []int
+		var gotDist []float64
+		tr.KNN(q, q, func(point [2]float64, data int, d float64) bool {
+			got = append(got, data)
+			gotDist = append(gotDist, d)
+			return len(got) < 100
+		})
+
+		if len(got) != 100 {
+			t.Fatalf("expected %d, got %d", 100, len(got))
+		}
+		for i := 0; i < len(got); i++ {
+			wantDist := dist(q, points[order[i]])
+			if math.Abs(gotDist[i]-wantDist) > 1e-9 {
+				t.Fatalf("at %d: expected dist %v, got %v", i, wantDist, gotDist[i])
+			}
+			if gotDist[i] != dist(q, points[got[i]]) {
+				t.Fatalf("at %d: dist does not match returned point", i)
+			}
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	N := 10_000
+	min, max := [2]float64{-180, -90}, [2]float64{180, 90}
+	points := randPoints(N, min, max)
+	data := make([]int, N)
+	for i := range data {
+		data[i] = i
+	}
+
+	incremental := New[int](min, max)
+	for i, p := range points {
+		incremental.Insert(p, i)
+	}
+
+	loaded := Load(min, max, points, data)
+	if loaded.Len() != incremental.Len() {
+		t.Fatalf("expected %d, got %d", incremental.Len(), loaded.Len())
+	}
+
+	imin, imax := incremental.MinBounds()
+	lmin, lmax := loaded.MinBounds()
+	if imin != lmin || imax != lmax {
+		t.Fatalf("expected '%v,%v', got '%v,%v'", imin, imax, lmin, lmax)
+	}
+
+	for i := 0; i < 64; i++ {
+		testSearch(t, loaded, points, 0)
+	}
+
+	var iscan, lscan []int
+	incremental.Scan(func(point [2]float64, data int) bool {
+		iscan = append(iscan, data)
+		return true
+	})
+	loaded.Scan(func(point [2]float64, data int) bool {
+		lscan = append(lscan, data)
+		return true
+	})
+	sort.Ints(iscan)
+	sort.Ints(lscan)
+	if len(iscan) != len(lscan) {
+		t.Fatalf("expected %d, got %d", len(iscan), len(lscan))
+	}
+	for i := range iscan {
+		if iscan[i] != lscan[i] {
+			t.Fatalf("scan mismatch at %d: expected %d, got %d", i, iscan[i], lscan[i])
+		}
+	}
+
+	for i, p := range points {
+		loaded.Delete(p, i)
+		if loaded.Len() != N-i-1 {
+			t.Fatalf("expected %d, got %d", N-i-1, loaded.Len())
+		}
+	}
+
+	viaFunc := LoadFunc(min, max, N, func(i int) ([2]float64, int) {
+		return points[i], i
+	})
+	if viaFunc.Len() != N {
+		t.Fatalf("expected %d, got %d", N, viaFunc.Len())
+	}
+}
+
+func BenchmarkLoad(b *testing.B) {
+	min, max := [2]float64{-180, -90}, [2]float64{180, 90}
+	points := randPoints(b.N, min, max)
+	data := make([]int, b.N)
+	for i := range data {
+		data[i] = i
+	}
+	b.ResetTimer()
+	Load(min, max, points, data)
+}
+
+func TestOpen(t *testing.T) {
+	for dims := 1; dims <= 4; dims++ {
+		min := make([]float64, dims)
+		max := make([]float64, dims)
+		for i := range min {
+			min[i], max[i] = -100, 100
+		}
+		tr, err := Open(min, max)
+		if err != nil {
+			t.Fatalf("dims=%d: %v", dims, err)
+		}
+		point := make([]float64, dims)
+		for i := range point {
+			point[i] = float64(i + 1)
+		}
+		tr.Insert(point, dims)
+		if tr.Len() != 1 {
+			t.Fatalf("dims=%d: expected %d, got %d", dims, 1, tr.Len())
+		}
+		var found bool
+		tr.Search(min, max, func(p []float64, data interface{}) bool {
+			if data.(int) == dims {
+				found = true
+			}
+			return true
+		})
+		if !found {
+			t.Fatalf("dims=%d: inserted point not found by Search", dims)
+		}
+		tmin, tmax := tr.MinBounds()
+		for i := range point {
+			if tmin[i] != point[i] || tmax[i] != point[i] {
+				t.Fatalf("dims=%d: expected bounds %v,%v, got %v,%v",
+					dims, point, point, tmin, tmax)
+			}
+		}
+		tr.Delete(point, dims)
+		if tr.Len() != 0 {
+			t.Fatalf("dims=%d: expected %d, got %d", dims, 0, tr.Len())
+		}
+	}
+
+	if _, err := Open([]float64{0}, []float64{0, 1}); err == nil {
+		t.Fatal("expected error for mismatched dimensions")
+	}
+	if _, err := Open([]float64{0, 0, 0, 0, 0}, []float64{1, 1, 1, 1, 1}); err == nil {
+		t.Fatal("expected error for unsupported number of dimensions")
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	min, max := [2]float64{-180, -90}, [2]float64{180, 90}
+	tr := New[int](min, max)
+	points := randPoints(1000, min, max)
+	for i := 0; i < 500; i++ {
+		tr.Insert(points[i], i)
+	}
+
+	snap := tr.Snapshot()
+	if snap.Len() != tr.Len() {
+		t.Fatalf("expected %d, got %d", tr.Len(), snap.Len())
+	}
+
+	// writes to tr after the snapshot must not be visible through snap.
+	tr.Insert(points[500], 500)
+	if tr.Len() != 501 {
+		t.Fatalf("expected %d, got %d", 501, tr.Len())
+	}
+	if snap.Len() != 500 {
+		t.Fatalf("expected %d, got %d", 500, snap.Len())
+	}
+	var found bool
+	snap.Search(points[500], points[500],
+		func(point [2]float64, data int) bool {
+			found = true
+			return true
+		},
+	)
+	if found {
+		t.Fatal("snapshot observed a write made after it was taken")
+	}
+
+	// writes to snap must not be visible through tr.
+	snap.Delete(points[0], 0)
+	if snap.Len() != 499 {
+		t.Fatalf("expected %d, got %d", 499, snap.Len())
+	}
+	if tr.Len() != 501 {
+		t.Fatalf("expected %d, got %d", 501, tr.Len())
+	}
+	found = false
+	tr.Search(points[0], points[0],
+		func(point [2]float64, data int) bool {
+			found = true
+			return true
+		},
+	)
+	if !found {
+		t.Fatal("delete on the snapshot leaked into the parent tree")
+	}
+}
+
+// BenchmarkInsertMutable is the baseline: repeated inserts into a single
+// tree with no snapshotting, so every write mutates in place.
+func BenchmarkInsertMutable(b *testing.B) {
+	min, max := [2]float64{-180, -90}, [2]float64{180, 90}
+	points := randPoints(b.N, min, max)
+	tr := New[int](min, max)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tr.Insert(points[i], i)
+	}
+}
+
+// BenchmarkInsertSnapshot measures the write amplification of path-copying
+// by taking a snapshot before every insert, forcing each write to clone
+// its full root-to-leaf path.
+func BenchmarkInsertSnapshot(b *testing.B) {
+	min, max := [2]float64{-180, -90}, [2]float64{180, 90}
+	points := randPoints(b.N, min, max)
+	tr := New[int](min, max)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tr = tr.Snapshot()
+		tr.Insert(points[i], i)
+	}
+}
+
+// BenchmarkInsertTyped and BenchmarkInsertAny insert the same points with
+// the same payload value, typed as int and boxed as interface{}
+// respectively, so -benchmem shows the per-item allocation that a typed
+// PTree[int] avoids but a PTree[any] (and the pre-generics API) still
+// pays.
+func BenchmarkInsertTyped(b *testing.B) {
+	min, max := [2]float64{-180, -90}, [2]float64{180, 90}
+	points := randPoints(b.N, min, max)
+	tr := New[int](min, max)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tr.Insert(points[i], i)
+	}
+}
+
+func BenchmarkInsertAny(b *testing.B) {
+	min, max := [2]float64{-180, -90}, [2]float64{180, 90}
+	points := randPoints(b.N, min, max)
+	tr := New[interface{}](min, max)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tr.Insert(points[i], i)
+	}
+}
+
+// BenchmarkSearchTyped and BenchmarkSearchAny are the point-lookup
+// counterparts of BenchmarkInsertTyped/BenchmarkInsertAny: same tree
+// contents, typed vs boxed payload, measured with -benchmem.
+func BenchmarkSearchTyped(b *testing.B) {
+	min, max := [2]float64{-180, -90}, [2]float64{180, 90}
+	points := randPoints(b.N, min, max)
+	tr := New[int](min, max)
+	for i, p := range points {
+		tr.Insert(p, i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tr.Search(points[i], points[i], func(point [2]float64, data int) bool {
+			return true
+		})
+	}
+}
+
+func BenchmarkSearchAny(b *testing.B) {
+	min, max := [2]float64{-180, -90}, [2]float64{180, 90}
+	points := randPoints(b.N, min, max)
+	tr := New[interface{}](min, max)
+	for i, p := range points {
+		tr.Insert(p, i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tr.Search(points[i], points[i], func(point [2]float64, data interface{}) bool {
+			return true
+		})
+	}
+}
+
 func TestBench(t *testing.T) {
 	N := 1_000_000
 	points := randPoints(N, [2]float64{-180, -90}, [2]float64{180, 90})
-	tr := New([2]float64{-180, -90}, [2]float64{180, 90})
+	tr := New[int]([2]float64{-180, -90}, [2]float64{180, 90})
 	lotsa.Output = os.Stdout
 	print("insert:  ")
 	lotsa.Ops(N, 1, func(i, _ int) {
@@ -284,8 +600,8 @@ func TestBench(t *testing.T) {
 	lotsa.Ops(N, 1, func(i, _ int) {
 		var found bool
 		tr.Search(points[i], points[i],
-			func(point [2]float64, data interface{}) bool {
-				if data.(int) == i {
+			func(point [2]float64, data int) bool {
+				if data == i {
 					found = true
 					return false
 				}
@@ -301,3 +617,24 @@ func TestBench(t *testing.T) {
 		tr.Delete(points[i], i)
 	})
 }
+
+// TestBenchLoad compares bulk-loading the same 1M points that TestBench
+// inserts one at a time, against a single Load call.
+func TestBenchLoad(t *testing.T) {
+	N := 1_000_000
+	min, max := [2]float64{-180, -90}, [2]float64{180, 90}
+	points := randPoints(N, min, max)
+	data := make([]int, N)
+	for i := range data {
+		data[i] = i
+	}
+	lotsa.Output = os.Stdout
+	var tr *PTree[int]
+	print("load:    ")
+	lotsa.Ops(1, 1, func(_, _ int) {
+		tr = Load(min, max, points, data)
+	})
+	if tr.Len() != N {
+		t.Fatalf("expected %d, got %d", N, tr.Len())
+	}
+}